@@ -0,0 +1,220 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bitbucket implements a client for the Bitbucket Server (Stash)
+// REST API, providing enough of the API surface for jenkins-operator to
+// report build status back to pull requests hosted there.
+package bitbucket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/scmprovider"
+)
+
+// Client interacts with a Bitbucket Server instance over its REST API.
+type Client struct {
+	client    *http.Client
+	endpoint  string
+	tokenFunc func() string
+	dry       bool
+	logger    *logrus.Entry
+}
+
+// NewClient creates a Bitbucket Server client that makes mutating calls.
+func NewClient(token, endpoint string) *Client {
+	return NewClientWithTokenSource(func() string { return token }, endpoint)
+}
+
+// NewClientWithTokenSource creates a Bitbucket Server client that reads its
+// token from tokenFunc on every request, so that callers can back it with a
+// secret.Agent accessor and pick up rotated tokens without reconstructing
+// the client.
+func NewClientWithTokenSource(tokenFunc func() string, endpoint string) *Client {
+	return &Client{
+		client:    &http.Client{},
+		endpoint:  endpoint,
+		tokenFunc: tokenFunc,
+		logger:    logrus.WithField("client", "bitbucket"),
+	}
+}
+
+// NewDryRunClient creates a Bitbucket Server client that logs mutating
+// calls instead of making them, mirroring github.NewDryRunClient.
+func NewDryRunClient(token, endpoint string) *Client {
+	c := NewClient(token, endpoint)
+	c.dry = true
+	return c
+}
+
+// AsSCMProvider wraps the client as a scmprovider.SCMProvider.
+func AsSCMProvider(c *Client) scmprovider.SCMProvider {
+	return c
+}
+
+// SetDryRun toggles whether mutating calls are logged instead of made.
+func (c *Client) SetDryRun(dry bool) {
+	c.dry = dry
+}
+
+// request issues method against path under endpoint's "/rest" API root,
+// e.g. request(http.MethodGet, "/api/1.0/...", nil) hits
+// endpoint+"/rest/api/1.0/...". Every Bitbucket Server REST API, including
+// build-status, lives under /rest, so endpoint takes a bare host the same
+// way --github-endpoint and --gitlab-endpoint do; callers don't append
+// /rest themselves.
+func (c *Client) request(method, path string, body interface{}) ([]byte, error) {
+	var reqBody *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(raw)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, c.endpoint+"/rest"+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.tokenFunc())
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("bitbucket: %s %s returned %d: %s", method, path, resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+// buildStatus is the Bitbucket Server build status payload.
+type buildStatus struct {
+	State string `json:"state"`
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Desc  string `json:"description"`
+}
+
+func toBitbucketState(s github.Status) string {
+	switch s.State {
+	case "success":
+		return "SUCCESSFUL"
+	case "pending":
+		return "INPROGRESS"
+	default:
+		return "FAILED"
+	}
+}
+
+// CreateStatus posts a build status for sha, implementing scmprovider.SCMProvider.
+func (c *Client) CreateStatus(org, repo, sha string, s github.Status) error {
+	bs := buildStatus{
+		State: toBitbucketState(s),
+		Key:   s.Context,
+		Name:  s.Context,
+		URL:   s.TargetURL,
+		Desc:  s.Description,
+	}
+	if c.dry {
+		c.logger.WithFields(logrus.Fields{"org": org, "repo": repo, "sha": sha}).Infof("would post build status: %+v", bs)
+		return nil
+	}
+	_, err := c.request(http.MethodPost, fmt.Sprintf("/build-status/1.0/commits/%s", sha), bs)
+	return err
+}
+
+// pullRequest is the subset of the Bitbucket Server PR resource we consume.
+type pullRequest struct {
+	ID      int `json:"id"`
+	FromRef struct {
+		LatestCommit string `json:"latestCommit"`
+	} `json:"fromRef"`
+	ToRef struct {
+		ID string `json:"id"`
+	} `json:"toRef"`
+	Author struct {
+		User struct {
+			Name string `json:"name"`
+		} `json:"user"`
+	} `json:"author"`
+}
+
+// GetPullRequest fetches the pull request, implementing scmprovider.SCMProvider.
+func (c *Client) GetPullRequest(org, repo string, number int) (*scmprovider.PullRequest, error) {
+	body, err := c.request(http.MethodGet, fmt.Sprintf("/api/1.0/projects/%s/repos/%s/pull-requests/%d", org, repo, number), nil)
+	if err != nil {
+		return nil, err
+	}
+	var pr pullRequest
+	if err := json.Unmarshal(body, &pr); err != nil {
+		return nil, err
+	}
+	return &scmprovider.PullRequest{
+		Number:  pr.ID,
+		Author:  pr.Author.User.Name,
+		HeadSHA: pr.FromRef.LatestCommit,
+		BaseRef: pr.ToRef.ID,
+	}, nil
+}
+
+// ListPullRequestFiles lists changed paths, implementing scmprovider.SCMProvider.
+func (c *Client) ListPullRequestFiles(org, repo string, number int) ([]string, error) {
+	body, err := c.request(http.MethodGet, fmt.Sprintf("/api/1.0/projects/%s/repos/%s/pull-requests/%d/changes", org, repo, number), nil)
+	if err != nil {
+		return nil, err
+	}
+	var changes struct {
+		Values []struct {
+			Path struct {
+				ToString string `json:"toString"`
+			} `json:"path"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(body, &changes); err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(changes.Values))
+	for _, v := range changes.Values {
+		files = append(files, v.Path.ToString)
+	}
+	return files, nil
+}
+
+// CreateComment posts a comment on the pull request, implementing scmprovider.SCMProvider.
+func (c *Client) CreateComment(org, repo string, number int, comment string) error {
+	if c.dry {
+		c.logger.WithFields(logrus.Fields{"org": org, "repo": repo, "number": number}).Infof("would comment: %s", comment)
+		return nil
+	}
+	_, err := c.request(http.MethodPost, fmt.Sprintf("/api/1.0/projects/%s/repos/%s/pull-requests/%d/comments", org, repo, number), map[string]string{"text": comment})
+	return err
+}
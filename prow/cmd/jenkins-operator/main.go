@@ -18,28 +18,29 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
 
-	"github.com/NYTimes/gziphandler"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/labels"
 
+	"k8s.io/test-infra/prow/bitbucket"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/gitlab"
 	"k8s.io/test-infra/prow/jenkins"
+	"k8s.io/test-infra/prow/jenkinsoperator"
 	"k8s.io/test-infra/prow/kube"
-	m "k8s.io/test-infra/prow/metrics"
+	"k8s.io/test-infra/prow/scmprovider"
+	"k8s.io/test-infra/prow/secret"
 )
 
 var (
@@ -54,19 +55,65 @@ var (
 	keyFile                = flag.String("key-file", "", "Path to a PEM-encoded key file.")
 	caCertFile             = flag.String("ca-cert-file", "", "Path to a PEM-encoded CA certificate file.")
 
+	jenkinsOIDCIssuer           = flag.String("jenkins-oidc-issuer", "", "OIDC issuer URL (Keycloak/Dex) to fetch Jenkins bearer tokens from. Mutually exclusive with --jenkins-token-file/--jenkins-bearer-token-file.")
+	jenkinsOIDCClientID         = flag.String("jenkins-oidc-client-id", "", "OIDC client ID used for the client-credentials flow.")
+	jenkinsOIDCClientSecretFile = flag.String("jenkins-oidc-client-secret-file", "", "Path to the file containing the OIDC client secret.")
+	jenkinsOIDCScopes           = flag.String("jenkins-oidc-scopes", "", "Comma-separated list of OIDC scopes to request.")
+	jenkinsOIDCTokenURL         = flag.String("jenkins-oidc-token-url", "", "OIDC token endpoint. When unset, discovered from --jenkins-oidc-issuer's /.well-known/openid-configuration.")
+
+	scmProvider = flag.String("scm-provider", "github", "SCM provider to report statuses to. One of: github, bitbucket, gitlab.")
+
 	githubEndpoint  = flag.String("github-endpoint", "https://api.github.com", "GitHub's API endpoint.")
 	githubTokenFile = flag.String("github-token-file", "/etc/github/oauth", "Path to the file containing the GitHub OAuth token.")
-	dryRun          = flag.Bool("dry-run", true, "Whether or not to make mutating API calls to GitHub.")
+
+	bitbucketEndpoint  = flag.String("bitbucket-endpoint", "", "Bitbucket Server's base URL, e.g. https://bitbucket.example.com (no /rest suffix; the client appends REST API paths itself).")
+	bitbucketTokenFile = flag.String("bitbucket-token-file", "", "Path to the file containing the Bitbucket Server API token.")
+
+	gitlabEndpoint  = flag.String("gitlab-endpoint", "https://gitlab.com", "GitLab's API endpoint.")
+	gitlabTokenFile = flag.String("gitlab-token-file", "", "Path to the file containing the GitLab API token.")
+
+	dryRun = flag.Bool("dry-run", true, "Whether or not to make mutating API calls to the SCM provider.")
+
+	resyncInterval = flag.Duration("resync-interval", jenkinsoperator.DefaultResyncInterval, "How often to resync ProwJobs against Jenkins builds.")
+	gatherInterval = flag.Duration("gather-interval", jenkinsoperator.DefaultGatherInterval, "How often to gather Jenkins metrics.")
+
+	jenkinsMastersConfig = flag.String("jenkins-masters-config", "", "Path to a file listing multiple Jenkins masters to fan out across (see jenkins.LoadMastersConfig). When set, takes precedence over --jenkins-url and the other single-master --jenkins-* flags.")
+
+	disabledComponents stringsFlag
 )
 
+// defaultMasterName labels the single Jenkins master built from the legacy
+// --jenkins-url et al. flags, used when --jenkins-masters-config is unset.
+const defaultMasterName = "default"
+
+func init() {
+	flag.Var(&disabledComponents, "disable", fmt.Sprintf("Component to disable; may be repeated. One of: %s, %s, %s, %s, %s.",
+		jenkinsoperator.ComponentLogServing, jenkinsoperator.ComponentMetrics, jenkinsoperator.ComponentPushGateway, jenkinsoperator.ComponentGather, jenkinsoperator.ComponentSCMReporter))
+}
+
+// stringsFlag collects repeated occurrences of a flag.Value-based flag,
+// e.g. --disable=a --disable=b.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 func main() {
 	flag.Parse()
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 	logger := logrus.WithField("component", "jenkins-operator")
 
-	if _, err := labels.Parse(*selector); err != nil {
-		logger.WithError(err).Fatal("Error parsing label selector.")
+	disabled, err := jenkinsoperator.ValidateComponents(disabledComponents)
+	if err != nil {
+		logger.WithError(err).Fatal("Error validating --disable flags.")
 	}
+	logger.WithField("enabled", jenkinsoperator.EnabledComponents(disabled)).Info("Enabled jenkins-operator components computed.")
 
 	configAgent := &config.Agent{}
 	if err := configAgent.Start(*configPath); err != nil {
@@ -78,148 +125,306 @@ func main() {
 		logger.WithError(err).Fatal("Error getting kube client.")
 	}
 
-	ac := &jenkins.AuthConfig{}
-	if *jenkinsTokenFile != "" {
-		token, err := loadToken(*jenkinsTokenFile)
-		if err != nil {
-			logger.WithError(err).Fatalf("Could not read token file.")
-		}
-		ac.Basic = &jenkins.BasicAuthConfig{
-			User:  *jenkinsUserName,
-			Token: token,
-		}
-	} else if *jenkinsBearerTokenFile != "" {
-		token, err := loadToken(*jenkinsBearerTokenFile)
-		if err != nil {
-			logger.WithError(err).Fatalf("Could not read bearer token file.")
-		}
-		ac.BearerToken = &jenkins.BearerTokenAuthConfig{
-			Token: token,
-		}
-	} else {
-		logger.Fatal("An auth token for basic or bearer token auth must be supplied.")
+	masters, err := masterSpecs()
+	if err != nil {
+		logger.WithError(err).Fatal("Error building Jenkins master list.")
 	}
-	var tlsConfig *tls.Config
-	if *certFile != "" && *keyFile != "" {
-		config, err := loadCerts(*certFile, *keyFile, *caCertFile)
-		if err != nil {
-			logger.WithError(err).Fatalf("Could not read certificate files.")
-		}
-		tlsConfig = config
+	masterNames := make([]string, 0, len(masters))
+	for _, ms := range masters {
+		masterNames = append(masterNames, ms.name)
 	}
-	metrics := jenkins.NewMetrics()
-	jc := jenkins.NewClient(*jenkinsURL, tlsConfig, ac, logger, metrics.ClientMetrics)
+	logger.WithField("masters", masterNames).Info("Jenkins masters computed.")
 
-	oauthSecretRaw, err := ioutil.ReadFile(*githubTokenFile)
-	if err != nil {
-		logger.WithError(err).Fatalf("Could not read Github oauth secret file.")
+	// secretAgent watches every token and TLS file we load below and keeps
+	// them current, so that a Kubernetes Secret rotation takes effect
+	// without restarting this pod. The OIDC client secret is the exception:
+	// buildMaster reads it once at startup and it is not watched.
+	secretAgent := &secret.Agent{}
+	if err := secretAgent.Start(secretPathsToWatch(masters, disabled), "", "", ""); err != nil {
+		logger.WithError(err).Fatal("Error starting secret agent.")
 	}
-	oauthSecret := string(bytes.TrimSpace(oauthSecretRaw))
 
-	_, err = url.Parse(*githubEndpoint)
-	if err != nil {
-		logger.WithError(err).Fatal("Must specify a valid --github-endpoint URL.")
+	rotatingSC := scmprovider.NewRotatingProvider(nil)
+	if !disabled[jenkinsoperator.ComponentSCMReporter] {
+		secretAgent.OnReload = func(path string) {
+			if path != scmTokenFile() {
+				return
+			}
+			sc, err := newSCMProvider(*scmProvider, secretAgent)
+			if err != nil {
+				logger.WithError(err).Error("Error rebuilding SCM provider after token rotation.")
+				return
+			}
+			rotatingSC.Swap(sc)
+		}
 	}
 
-	var ghc *github.Client
-	if *dryRun {
-		ghc = github.NewDryRunClient(oauthSecret, *githubEndpoint)
-	} else {
-		ghc = github.NewClient(oauthSecret, *githubEndpoint)
+	// scmprovider.NewNoopProvider tells jenkins.Controller not to report
+	// statuses, which is how --disable=scm-reporter takes effect. The SCM
+	// provider is shared across every Jenkins master: it reports ProwJob
+	// status back to the source host, which doesn't vary per Jenkins master.
+	sc := scmprovider.NewNoopProvider()
+	if !disabled[jenkinsoperator.ComponentSCMReporter] {
+		initialSC, err := newSCMProvider(*scmProvider, secretAgent)
+		if err != nil {
+			logger.WithError(err).Fatal("Error constructing SCM provider.")
+		}
+		rotatingSC.Swap(initialSC)
+		sc = rotatingSC
 	}
 
-	c := jenkins.NewController(kc, jc, ghc, logger, configAgent, *selector)
+	masterServers := make([]jenkinsoperator.MasterServer, 0, len(masters))
+	for _, ms := range masters {
+		masterServer, err := buildMaster(ms, secretAgent, kc, configAgent, sc, logger)
+		if err != nil {
+			logger.WithError(err).Fatalf("Error building Jenkins master %q.", ms.name)
+		}
+		masterServers = append(masterServers, *masterServer)
+	}
 
-	// Push metrics to the configured prometheus pushgateway endpoint.
 	pushGateway := configAgent.Config().PushGateway
-	if pushGateway.Endpoint != "" {
-		go m.PushMetrics("jenkins-operator", pushGateway.Endpoint, pushGateway.Interval)
+	server := &jenkinsoperator.Server{
+		Masters:             masterServers,
+		Logger:              logger,
+		ResyncInterval:      *resyncInterval,
+		GatherInterval:      *gatherInterval,
+		PushGatewayEndpoint: pushGateway.Endpoint,
+		PushGatewayInterval: pushGateway.Interval,
+		Disabled:            disabled,
 	}
-	// Serve Jenkins logs here and proxy deck to use this endpoint
-	// instead of baking agent-specific logic in deck. This func also
-	// serves prometheus metrics.
-	go serve(jc)
-	// gather metrics for the jobs handled by the jenkins controller.
-	go gather(c, logger)
 
-	tick := time.Tick(30 * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	if err := server.Run(ctx); err != nil {
+		logger.WithError(err).Fatal("Error running jenkins-operator server.")
+	}
+}
+
+// masterSpec is the information needed to build one Jenkins master,
+// normalized from either the legacy single-master --jenkins-* flags or one
+// entry of the --jenkins-masters-config file.
+type masterSpec struct {
+	name          string
+	url           string
+	labelSelector string
+
+	username        string
+	tokenFile       string
+	bearerTokenFile string
+	oidc            *jenkins.MasterOIDCConfig
+
+	certFile, keyFile, caCertFile string
+}
 
-	for {
-		select {
-		case <-tick:
-			start := time.Now()
-			if err := c.Sync(); err != nil {
-				logger.WithError(err).Error("Error syncing.")
+// masterSpecs returns the Jenkins masters this operator should drive:
+// the single master described by --jenkins-url et al., unless
+// --jenkins-masters-config is set, in which case it returns every master
+// listed there instead.
+func masterSpecs() ([]masterSpec, error) {
+	if *jenkinsMastersConfig == "" {
+		if _, err := labels.Parse(*selector); err != nil {
+			return nil, fmt.Errorf("error parsing --label-selector: %v", err)
+		}
+		var oidc *jenkins.MasterOIDCConfig
+		if *jenkinsOIDCIssuer != "" {
+			if *jenkinsTokenFile != "" || *jenkinsBearerTokenFile != "" {
+				return nil, fmt.Errorf("--jenkins-oidc-issuer is mutually exclusive with --jenkins-token-file and --jenkins-bearer-token-file")
+			}
+			var scopes []string
+			if *jenkinsOIDCScopes != "" {
+				scopes = strings.Split(*jenkinsOIDCScopes, ",")
+			}
+			oidc = &jenkins.MasterOIDCConfig{
+				IssuerURL:        *jenkinsOIDCIssuer,
+				ClientID:         *jenkinsOIDCClientID,
+				ClientSecretFile: *jenkinsOIDCClientSecretFile,
+				Scopes:           scopes,
+				TokenURL:         *jenkinsOIDCTokenURL,
 			}
-			duration := time.Since(start)
-			logger.WithField("duration", fmt.Sprintf("%v", duration)).Info("Synced")
-			metrics.ResyncPeriod.Observe(duration.Seconds())
-		case <-sig:
-			logger.Info("Jenkins operator is shutting down...")
-			return
 		}
+		return []masterSpec{{
+			name:            defaultMasterName,
+			url:             *jenkinsURL,
+			labelSelector:   *selector,
+			username:        *jenkinsUserName,
+			tokenFile:       *jenkinsTokenFile,
+			bearerTokenFile: *jenkinsBearerTokenFile,
+			oidc:            oidc,
+			certFile:        *certFile,
+			keyFile:         *keyFile,
+			caCertFile:      *caCertFile,
+		}}, nil
 	}
-}
 
-func loadToken(file string) (string, error) {
-	raw, err := ioutil.ReadFile(file)
+	cfg, err := jenkins.LoadMastersConfig(*jenkinsMastersConfig)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("error loading --jenkins-masters-config: %v", err)
 	}
-	return string(bytes.TrimSpace(raw)), nil
+	specs := make([]masterSpec, 0, len(cfg.Masters))
+	for _, m := range cfg.Masters {
+		if _, err := labels.Parse(m.LabelSelector); err != nil {
+			return nil, fmt.Errorf("master %q: error parsing label selector: %v", m.Name, err)
+		}
+		specs = append(specs, masterSpec{
+			name:            m.Name,
+			url:             m.URL,
+			labelSelector:   m.LabelSelector,
+			username:        m.Username,
+			tokenFile:       m.TokenFile,
+			bearerTokenFile: m.BearerTokenFile,
+			oidc:            m.OIDC,
+			certFile:        m.CertFile,
+			keyFile:         m.KeyFile,
+			caCertFile:      m.CACertFile,
+		})
+	}
+	return specs, nil
 }
 
-func loadCerts(certFile, keyFile, caCertFile string) (*tls.Config, error) {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return nil, err
+// secretPathsToWatch lists every plain secret file the secret.Agent should
+// load and keep current: each master's Jenkins token, plus whichever
+// --scm-provider token file is in use, unless scm-reporter is disabled, in
+// which case no SCM provider is ever built and the token is never read. TLS
+// material is registered separately, per master, via secretAgent.AddCertBundle.
+func secretPathsToWatch(masters []masterSpec, disabled map[string]bool) []string {
+	var paths []string
+	for _, ms := range masters {
+		for _, p := range []string{ms.tokenFile, ms.bearerTokenFile} {
+			if p != "" {
+				paths = append(paths, p)
+			}
+		}
 	}
-
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
+	if !disabled[jenkinsoperator.ComponentSCMReporter] {
+		if p := scmTokenFile(); p != "" {
+			paths = append(paths, p)
+		}
 	}
+	return paths
+}
+
+// buildMaster constructs the jenkinsoperator.MasterServer for a single
+// Jenkins master: its auth config, TLS material (registered with
+// secretAgent under the master's name so it rotates independently of every
+// other master), client, metrics (labeled with the master's name), and
+// Controller.
+func buildMaster(ms masterSpec, secretAgent *secret.Agent, kc *kube.Client, configAgent *config.Agent, sc scmprovider.SCMProvider, logger *logrus.Entry) (*jenkinsoperator.MasterServer, error) {
+	logger = logger.WithField("master", ms.name)
+	metrics := jenkins.NewMetrics(ms.name)
 
-	if caCertFile != "" {
-		caCert, err := ioutil.ReadFile(caCertFile)
+	ac := &jenkins.AuthConfig{}
+	switch {
+	case ms.oidc != nil:
+		secretValue, err := loadToken(ms.oidc.ClientSecretFile)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("could not read OIDC client secret file: %v", err)
 		}
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
-		tlsConfig.RootCAs = caCertPool
+		tokenSource, err := jenkins.NewOIDCTokenSource(jenkins.OIDCConfig{
+			IssuerURL:    ms.oidc.IssuerURL,
+			ClientID:     ms.oidc.ClientID,
+			ClientSecret: secretValue,
+			Scopes:       ms.oidc.Scopes,
+			TokenURL:     ms.oidc.TokenURL,
+		}, metrics.ClientMetrics)
+		if err != nil {
+			return nil, fmt.Errorf("could not build OIDC token source: %v", err)
+		}
+		ac.TokenSource = tokenSource
+	case ms.tokenFile != "":
+		ac.Basic = &jenkins.BasicAuthConfig{
+			User:     ms.username,
+			GetToken: secretAgent.GetSecret(ms.tokenFile),
+		}
+	case ms.bearerTokenFile != "":
+		ac.TokenSource = jenkins.TokenSourceFunc(secretAgent.GetSecret(ms.bearerTokenFile))
+	default:
+		return nil, fmt.Errorf("an auth token for basic, bearer token, or OIDC auth must be supplied")
 	}
 
-	tlsConfig.BuildNameToCertificate()
-	return tlsConfig, nil
-}
+	var tlsConfig *tls.Config
+	if ms.certFile != "" && ms.keyFile != "" {
+		if err := secretAgent.AddCertBundle(ms.name, ms.certFile, ms.keyFile, ms.caCertFile); err != nil {
+			return nil, fmt.Errorf("error loading TLS material: %v", err)
+		}
+		tlsConfig = secretAgent.GetTLSConfigFor(ms.name)
+		if masterURL, err := url.Parse(ms.url); err == nil {
+			tlsConfig.ServerName = masterURL.Hostname()
+		}
+	}
+	jc := jenkins.NewClient(ms.url, tlsConfig, ac, logger, metrics.ClientMetrics)
+
+	c := jenkins.NewController(kc, jc, sc, logger, configAgent, ms.labelSelector)
 
-// serve starts a http server and serves Jenkins logs
-// and prometheus metrics. Meant to be called inside
-// a goroutine.
-func serve(jc *jenkins.Client) {
-	http.Handle("/", gziphandler.GzipHandler(handleLog(jc)))
-	http.Handle("/metrics", promhttp.Handler())
-	logrus.WithError(http.ListenAndServe(":8080", nil)).Fatal("ListenAndServe returned.")
+	return &jenkinsoperator.MasterServer{
+		Name:          ms.name,
+		Controller:    c,
+		JenkinsClient: jc,
+		Metrics:       metrics,
+	}, nil
 }
 
-// gather metrics from the jenkins controller.
-// Meant to be called inside a goroutine.
-func gather(c *jenkins.Controller, logger *logrus.Entry) {
-	tick := time.Tick(30 * time.Second)
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+// scmTokenFile returns the token file backing the currently selected
+// --scm-provider.
+func scmTokenFile() string {
+	switch *scmProvider {
+	case "bitbucket":
+		return *bitbucketTokenFile
+	case "gitlab":
+		return *gitlabTokenFile
+	default:
+		return *githubTokenFile
+	}
+}
 
-	for {
-		select {
-		case <-tick:
-			start := time.Now()
-			c.SyncMetrics()
-			logger.WithField("metrics-duration", fmt.Sprintf("%v", time.Since(start))).Debug("Metrics synced")
-		case <-sig:
-			logger.Debug("Jenkins operator gatherer is shutting down...")
-			return
+// newSCMProvider builds the SCM provider selected by --scm-provider, reading
+// its token through secretAgent (so a later rotation is picked up) and
+// validating its endpoint URL.
+func newSCMProvider(provider string, secretAgent *secret.Agent) (scmprovider.SCMProvider, error) {
+	switch provider {
+	case "github":
+		if _, err := url.Parse(*githubEndpoint); err != nil {
+			return nil, fmt.Errorf("must specify a valid --github-endpoint URL: %v", err)
+		}
+		token := secretAgent.GetSecret(*githubTokenFile)()
+		if *dryRun {
+			return scmprovider.NewGitHubProvider(github.NewDryRunClient(token, *githubEndpoint)), nil
+		}
+		return scmprovider.NewGitHubProvider(github.NewClient(token, *githubEndpoint)), nil
+	case "bitbucket":
+		if _, err := url.Parse(*bitbucketEndpoint); err != nil {
+			return nil, fmt.Errorf("must specify a valid --bitbucket-endpoint URL: %v", err)
 		}
+		tokenFunc := secretAgent.GetSecret(*bitbucketTokenFile)
+		c := bitbucket.NewClientWithTokenSource(tokenFunc, *bitbucketEndpoint)
+		if *dryRun {
+			c.SetDryRun(true)
+		}
+		return bitbucket.AsSCMProvider(c), nil
+	case "gitlab":
+		if _, err := url.Parse(*gitlabEndpoint); err != nil {
+			return nil, fmt.Errorf("must specify a valid --gitlab-endpoint URL: %v", err)
+		}
+		tokenFunc := secretAgent.GetSecret(*gitlabTokenFile)
+		c := gitlab.NewClientWithTokenSource(tokenFunc, *gitlabEndpoint)
+		if *dryRun {
+			c.SetDryRun(true)
+		}
+		return gitlab.AsSCMProvider(c), nil
+	default:
+		return nil, fmt.Errorf("unknown --scm-provider %q: must be one of github, bitbucket, gitlab", provider)
 	}
 }
+
+func loadToken(file string) (string, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(raw)), nil
+}
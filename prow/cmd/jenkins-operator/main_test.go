@@ -0,0 +1,44 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStringsFlag(t *testing.T) {
+	var f stringsFlag
+	for _, v := range []string{"a", "b", "c"} {
+		if err := f.Set(v); err != nil {
+			t.Fatalf("Set(%q) returned error: %v", v, err)
+		}
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual([]string(f), want) {
+		t.Errorf("f = %v, want %v", f, want)
+	}
+	if got, want := f.String(), "a,b,c"; got != want {
+		t.Errorf("f.String() = %q, want %q", got, want)
+	}
+}
+
+func TestStringsFlagEmpty(t *testing.T) {
+	var f stringsFlag
+	if got, want := f.String(), ""; got != want {
+		t.Errorf("f.String() = %q, want %q", got, want)
+	}
+}
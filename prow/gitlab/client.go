@@ -0,0 +1,202 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitlab implements a client for the GitLab v4 REST API, providing
+// enough of the API surface for jenkins-operator to report build status
+// back to merge requests hosted on GitLab.
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/scmprovider"
+)
+
+// Client interacts with a GitLab instance over its v4 REST API.
+type Client struct {
+	client    *http.Client
+	endpoint  string
+	tokenFunc func() string
+	dry       bool
+	logger    *logrus.Entry
+}
+
+// NewClient creates a GitLab client that makes mutating calls.
+func NewClient(token, endpoint string) *Client {
+	return NewClientWithTokenSource(func() string { return token }, endpoint)
+}
+
+// NewClientWithTokenSource creates a GitLab client that reads its token
+// from tokenFunc on every request, so that callers can back it with a
+// secret.Agent accessor and pick up rotated tokens without reconstructing
+// the client.
+func NewClientWithTokenSource(tokenFunc func() string, endpoint string) *Client {
+	return &Client{
+		client:    &http.Client{},
+		endpoint:  endpoint,
+		tokenFunc: tokenFunc,
+		logger:    logrus.WithField("client", "gitlab"),
+	}
+}
+
+// NewDryRunClient creates a GitLab client that logs mutating calls instead
+// of making them, mirroring github.NewDryRunClient.
+func NewDryRunClient(token, endpoint string) *Client {
+	c := NewClient(token, endpoint)
+	c.dry = true
+	return c
+}
+
+// AsSCMProvider wraps the client as a scmprovider.SCMProvider.
+func AsSCMProvider(c *Client) scmprovider.SCMProvider {
+	return c
+}
+
+// SetDryRun toggles whether mutating calls are logged instead of made.
+func (c *Client) SetDryRun(dry bool) {
+	c.dry = dry
+}
+
+func (c *Client) request(method, path string, body interface{}) ([]byte, error) {
+	var reqBody *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(raw)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, c.endpoint+"/api/v4"+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.tokenFunc())
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("gitlab: %s %s returned %d: %s", method, path, resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+func toGitLabState(s github.Status) string {
+	switch s.State {
+	case "success":
+		return "success"
+	case "pending":
+		return "running"
+	case "error":
+		return "failed"
+	default:
+		return "failed"
+	}
+}
+
+// CreateStatus posts a commit status, implementing scmprovider.SCMProvider.
+func (c *Client) CreateStatus(org, repo, sha string, s github.Status) error {
+	project := url.QueryEscape(org + "/" + repo)
+	payload := map[string]string{
+		"state":       toGitLabState(s),
+		"target_url":  s.TargetURL,
+		"description": s.Description,
+		"context":     s.Context,
+	}
+	if c.dry {
+		c.logger.WithFields(logrus.Fields{"org": org, "repo": repo, "sha": sha}).Infof("would post commit status: %+v", payload)
+		return nil
+	}
+	_, err := c.request(http.MethodPost, fmt.Sprintf("/projects/%s/statuses/%s", project, sha), payload)
+	return err
+}
+
+type mergeRequest struct {
+	IID          int    `json:"iid"`
+	SHA          string `json:"sha"`
+	TargetBranch string `json:"target_branch"`
+	Author       struct {
+		Username string `json:"username"`
+	} `json:"author"`
+}
+
+// GetPullRequest fetches the merge request, implementing scmprovider.SCMProvider.
+func (c *Client) GetPullRequest(org, repo string, number int) (*scmprovider.PullRequest, error) {
+	project := url.QueryEscape(org + "/" + repo)
+	body, err := c.request(http.MethodGet, fmt.Sprintf("/projects/%s/merge_requests/%d", project, number), nil)
+	if err != nil {
+		return nil, err
+	}
+	var mr mergeRequest
+	if err := json.Unmarshal(body, &mr); err != nil {
+		return nil, err
+	}
+	return &scmprovider.PullRequest{
+		Number:  mr.IID,
+		Author:  mr.Author.Username,
+		HeadSHA: mr.SHA,
+		BaseRef: mr.TargetBranch,
+	}, nil
+}
+
+// ListPullRequestFiles lists changed paths, implementing scmprovider.SCMProvider.
+func (c *Client) ListPullRequestFiles(org, repo string, number int) ([]string, error) {
+	project := url.QueryEscape(org + "/" + repo)
+	body, err := c.request(http.MethodGet, fmt.Sprintf("/projects/%s/merge_requests/%d/changes", project, number), nil)
+	if err != nil {
+		return nil, err
+	}
+	var changes struct {
+		Changes []struct {
+			NewPath string `json:"new_path"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(body, &changes); err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(changes.Changes))
+	for _, ch := range changes.Changes {
+		files = append(files, ch.NewPath)
+	}
+	return files, nil
+}
+
+// CreateComment posts a note on the merge request, implementing scmprovider.SCMProvider.
+func (c *Client) CreateComment(org, repo string, number int, comment string) error {
+	if c.dry {
+		c.logger.WithFields(logrus.Fields{"org": org, "repo": repo, "number": number}).Infof("would comment: %s", comment)
+		return nil
+	}
+	project := url.QueryEscape(org + "/" + repo)
+	_, err := c.request(http.MethodPost, fmt.Sprintf("/projects/%s/merge_requests/%d/notes", project, number), map[string]string{"body": comment})
+	return err
+}
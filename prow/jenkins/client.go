@@ -0,0 +1,185 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jenkins implements a client for the Jenkins JSON API, the
+// Controller that syncs ProwJobs against Jenkins builds, and the metrics
+// both report.
+package jenkins
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuthConfig selects how Client authenticates to Jenkins. Exactly one of
+// Basic or TokenSource should be set.
+type AuthConfig struct {
+	// Basic configures HTTP Basic auth.
+	Basic *BasicAuthConfig
+	// TokenSource configures bearer-token auth, e.g. a static token file or
+	// an OIDC client-credentials flow (see NewOIDCTokenSource).
+	TokenSource TokenSource
+}
+
+// BasicAuthConfig is a username paired with a token accessor. GetToken is
+// called on every request rather than once at startup, so a secret.Agent
+// accessor can be plugged in here and a later token rotation takes effect
+// without rebuilding the Client.
+type BasicAuthConfig struct {
+	User     string
+	GetToken func() string
+}
+
+// Client talks to a single Jenkins master's JSON API.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	authConfig *AuthConfig
+	logger     *logrus.Entry
+	metrics    *ClientMetrics
+}
+
+// NewClient creates a Client for the Jenkins master at baseURL. tlsConfig
+// may be nil, in which case the default transport's TLS settings are used.
+func NewClient(baseURL string, tlsConfig *tls.Config, authConfig *AuthConfig, logger *logrus.Entry, metrics *ClientMetrics) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Timeout:   30 * time.Second,
+		},
+		authConfig: authConfig,
+		logger:     logger,
+		metrics:    metrics,
+	}
+}
+
+// setAuth applies c.authConfig to req, reading the current token or
+// password on every call so that a rotated secret takes effect on the very
+// next request.
+func (c *Client) setAuth(req *http.Request) error {
+	switch {
+	case c.authConfig.Basic != nil:
+		req.SetBasicAuth(c.authConfig.Basic.User, c.authConfig.Basic.GetToken())
+	case c.authConfig.TokenSource != nil:
+		token, err := c.authConfig.TokenSource.Token()
+		if err != nil {
+			return fmt.Errorf("error getting bearer token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// do sets auth on req and executes it, recording a RequestErrors metric on
+// failure.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if err := c.setAuth(req); err != nil {
+		c.metrics.RequestErrors.WithLabelValues("auth").Inc()
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.metrics.RequestErrors.WithLabelValues("transport").Inc()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetLog fetches the console log for a completed or in-progress build.
+func (c *Client) GetLog(job, buildID string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/job/%s/%s/consoleText", c.baseURL, url.PathEscape(job), url.PathEscape(buildID)), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.metrics.RequestErrors.WithLabelValues("status").Inc()
+		return nil, fmt.Errorf("unexpected response code %d fetching log for %s/%s", resp.StatusCode, job, buildID)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Status is a Jenkins build's state, as reported by its api/json endpoint.
+type Status struct {
+	Building bool   `json:"building"`
+	Result   string `json:"result"`
+	Number   int    `json:"number"`
+
+	// Success is derived from Result rather than unmarshaled directly.
+	Success bool `json:"-"`
+}
+
+// BuildStatus fetches the status of a single build.
+func (c *Client) BuildStatus(job, buildID string) (*Status, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/job/%s/%s/api/json", c.baseURL, url.PathEscape(job), url.PathEscape(buildID)), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.metrics.RequestErrors.WithLabelValues("status").Inc()
+		return nil, fmt.Errorf("unexpected response code %d fetching status for %s/%s", resp.StatusCode, job, buildID)
+	}
+
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	status.Success = status.Result == "SUCCESS"
+	return &status, nil
+}
+
+// QueueLen returns the number of items currently in the Jenkins build queue.
+func (c *Client) QueueLen() (int, error) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+"/queue/api/json", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.metrics.RequestErrors.WithLabelValues("status").Inc()
+		return 0, fmt.Errorf("unexpected response code %d fetching queue", resp.StatusCode)
+	}
+
+	var payload struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return 0, err
+	}
+	return len(payload.Items), nil
+}
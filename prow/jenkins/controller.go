@@ -0,0 +1,145 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkins
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/kube"
+	"k8s.io/test-infra/prow/scmprovider"
+)
+
+// Controller syncs ProwJobs against Jenkins builds: it updates ProwJob status
+// from completed builds and reports that status back to the SCM hosting the
+// change under test. It does not start builds; a ProwJob with no Jenkins
+// build ID is left as it is.
+type Controller struct {
+	kc          *kube.Client
+	jc          *Client
+	sc          scmprovider.SCMProvider
+	logger      *logrus.Entry
+	configAgent *config.Agent
+	selector    string
+}
+
+// NewController builds a Controller. sc may be a no-op scmprovider.SCMProvider
+// (see scmprovider.NewNoopProvider) when status reporting is disabled; it must
+// not be nil, since Sync calls its methods unconditionally.
+func NewController(kc *kube.Client, jc *Client, sc scmprovider.SCMProvider, logger *logrus.Entry, configAgent *config.Agent, selector string) *Controller {
+	return &Controller{
+		kc:          kc,
+		jc:          jc,
+		sc:          sc,
+		logger:      logger,
+		configAgent: configAgent,
+		selector:    selector,
+	}
+}
+
+// Sync lists every ProwJob matching the selector, advances each one whose
+// Jenkins build has finished, and reports the result back through sc.
+func (c *Controller) Sync() error {
+	pjs, err := c.kc.ListProwJobs(c.selector)
+	if err != nil {
+		return fmt.Errorf("error listing prowjobs: %v", err)
+	}
+
+	var syncErrs []error
+	for _, pj := range pjs {
+		if err := c.syncProwJob(pj); err != nil {
+			syncErrs = append(syncErrs, fmt.Errorf("%s: %v", pj.Spec.Job, err))
+		}
+	}
+	if len(syncErrs) > 0 {
+		return fmt.Errorf("error syncing %d/%d prowjob(s): %v", len(syncErrs), len(pjs), syncErrs)
+	}
+	return nil
+}
+
+// syncProwJob advances a single ProwJob that is still running in Jenkins. It
+// is a no-op for ProwJobs Jenkins hasn't been asked to build yet, or whose
+// build is still in progress.
+func (c *Controller) syncProwJob(pj kube.ProwJob) error {
+	if pj.Status.State != kube.PendingState && pj.Status.State != kube.TriggeredState {
+		return nil
+	}
+	if pj.Status.JenkinsBuildID == "" {
+		return nil
+	}
+
+	status, err := c.jc.BuildStatus(pj.Spec.Job, pj.Status.JenkinsBuildID)
+	if err != nil {
+		return fmt.Errorf("error getting build status: %v", err)
+	}
+	if status.Building {
+		return nil
+	}
+
+	newState := kube.FailureState
+	if status.Success {
+		newState = kube.SuccessState
+	}
+	if err := c.kc.ReplaceProwJobStatus(pj, newState); err != nil {
+		return fmt.Errorf("error updating prowjob status: %v", err)
+	}
+	return c.reportStatus(pj, newState)
+}
+
+// reportStatus posts pj's outcome back to the SCM host the change under test
+// came from. It is always called, even when reporting is disabled, in which
+// case c.sc is a no-op scmprovider.SCMProvider.
+func (c *Controller) reportStatus(pj kube.ProwJob, state kube.ProwJobState) error {
+	if len(pj.Spec.Refs.Pulls) == 0 {
+		return nil
+	}
+	pull := pj.Spec.Refs.Pulls[0]
+
+	return c.sc.CreateStatus(pj.Spec.Refs.Org, pj.Spec.Refs.Repo, pull.SHA, github.Status{
+		State:       scmStateFor(state),
+		TargetURL:   pj.Status.URL,
+		Description: pj.Status.Description,
+		Context:     pj.Spec.Context,
+	})
+}
+
+// scmStateFor maps a ProwJob's terminal state to the tri-state value SCM
+// providers expect in a commit status.
+func scmStateFor(state kube.ProwJobState) string {
+	switch state {
+	case kube.SuccessState:
+		return "success"
+	case kube.FailureState:
+		return "failure"
+	default:
+		return "error"
+	}
+}
+
+// SyncMetrics gathers metrics directly from Jenkins, such as the build queue
+// length, and records them against this master's Metrics.
+func (c *Controller) SyncMetrics() {
+	queueLen, err := c.jc.QueueLen()
+	if err != nil {
+		c.logger.WithError(err).Error("Error getting Jenkins queue length.")
+		return
+	}
+	c.jc.metrics.JenkinsQueueLength.Set(float64(queueLen))
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkins
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+)
+
+// MastersConfig lists every Jenkins master jenkins-operator should drive,
+// read from the file named by --jenkins-masters-config.
+type MastersConfig struct {
+	Masters []MasterConfig `json:"masters"`
+}
+
+// MasterConfig describes a single Jenkins master: where it lives, how to
+// authenticate to it, and which ProwJobs it's responsible for.
+type MasterConfig struct {
+	// Name labels metrics and logs for this master; must be unique.
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// LabelSelector selects the ProwJobs this master builds. See
+	// k8s.io/apimachinery/pkg/labels for the selector syntax.
+	LabelSelector string `json:"label_selector"`
+
+	Username        string            `json:"username,omitempty"`
+	TokenFile       string            `json:"token_file,omitempty"`
+	BearerTokenFile string            `json:"bearer_token_file,omitempty"`
+	OIDC            *MasterOIDCConfig `json:"oidc,omitempty"`
+
+	CertFile   string `json:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+	CACertFile string `json:"ca_cert_file,omitempty"`
+}
+
+// MasterOIDCConfig is the OIDC client-credentials configuration for a
+// single master, mirroring the --jenkins-oidc-* flags.
+type MasterOIDCConfig struct {
+	IssuerURL        string   `json:"issuer_url"`
+	ClientID         string   `json:"client_id"`
+	ClientSecretFile string   `json:"client_secret_file"`
+	Scopes           []string `json:"scopes,omitempty"`
+
+	// TokenURL overrides the token endpoint discovered from IssuerURL; see
+	// OIDCConfig.TokenURL.
+	TokenURL string `json:"token_url,omitempty"`
+}
+
+// LoadMastersConfig reads and validates the --jenkins-masters-config file.
+func LoadMastersConfig(path string) (*MastersConfig, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg MastersConfig
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("error unmarshaling %s: %v", path, err)
+	}
+	if len(cfg.Masters) == 0 {
+		return nil, fmt.Errorf("%s defines no masters", path)
+	}
+	seen := map[string]bool{}
+	for _, m := range cfg.Masters {
+		if m.Name == "" {
+			return nil, fmt.Errorf("master with url %q has no name", m.URL)
+		}
+		if seen[m.Name] {
+			return nil, fmt.Errorf("duplicate master name %q", m.Name)
+		}
+		seen[m.Name] = true
+		if m.URL == "" {
+			return nil, fmt.Errorf("master %q has no url", m.Name)
+		}
+		if m.LabelSelector == "" {
+			return nil, fmt.Errorf("master %q has no label_selector; an empty selector would match every ProwJob", m.Name)
+		}
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkins
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeMastersConfig(t *testing.T, contents string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "masters-config")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "masters.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+	return path
+}
+
+func TestLoadMastersConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{
+			name: "valid single master",
+			yaml: `
+masters:
+- name: default
+  url: https://jenkins.example.com
+  label_selector: master=default
+`,
+		},
+		{
+			name: "no masters",
+			yaml: `
+masters: []
+`,
+			wantErr: true,
+		},
+		{
+			name: "missing name",
+			yaml: `
+masters:
+- url: https://jenkins.example.com
+  label_selector: master=default
+`,
+			wantErr: true,
+		},
+		{
+			name: "missing url",
+			yaml: `
+masters:
+- name: default
+  label_selector: master=default
+`,
+			wantErr: true,
+		},
+		{
+			name: "missing label selector",
+			yaml: `
+masters:
+- name: default
+  url: https://jenkins.example.com
+`,
+			wantErr: true,
+		},
+		{
+			name: "duplicate name",
+			yaml: `
+masters:
+- name: default
+  url: https://jenkins.example.com
+  label_selector: master=default
+- name: default
+  url: https://jenkins2.example.com
+  label_selector: master=default2
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeMastersConfig(t, tt.yaml)
+			_, err := LoadMastersConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadMastersConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadMastersConfigMissingFile(t *testing.T) {
+	if _, err := LoadMastersConfig("/does/not/exist.yaml"); err == nil {
+		t.Fatal("expected an error loading a nonexistent masters config, got nil")
+	}
+}
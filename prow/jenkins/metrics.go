@@ -0,0 +1,84 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkins
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ClientMetrics is the subset of Metrics that Client (and the TokenSources it
+// is configured with) record against directly, as opposed to the
+// Controller-level sync metrics.
+type ClientMetrics struct {
+	OIDCRefreshes *prometheus.CounterVec
+	RequestErrors *prometheus.CounterVec
+
+	// JenkinsQueueLength is the same gauge as Metrics.JenkinsQueueLength,
+	// reachable here so that Controller.SyncMetrics can set it through its
+	// Client.
+	JenkinsQueueLength prometheus.Gauge
+}
+
+// Metrics holds every Prometheus metric jenkins-operator reports for one
+// Jenkins master. Every metric carries a jenkins_master label set to the
+// name passed to NewMetrics, so masters can be distinguished in queries and
+// dashboards once jenkins-operator drives more than one.
+type Metrics struct {
+	ClientMetrics *ClientMetrics
+
+	ResyncPeriod       prometheus.Histogram
+	JenkinsQueueLength prometheus.Gauge
+}
+
+// NewMetrics creates and registers every Prometheus metric jenkins-operator
+// reports for the Jenkins master named masterName. It must be called once
+// per master: registering two Metrics for the same masterName panics, since
+// Prometheus rejects duplicate collectors.
+func NewMetrics(masterName string) *Metrics {
+	constLabels := prometheus.Labels{"jenkins_master": masterName}
+
+	m := &Metrics{
+		ClientMetrics: &ClientMetrics{
+			OIDCRefreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name:        "jenkins_oidc_refreshes_total",
+				Help:        "Count of Jenkins OIDC bearer-token refreshes by result.",
+				ConstLabels: constLabels,
+			}, []string{"result"}),
+			RequestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name:        "jenkins_request_errors_total",
+				Help:        "Count of failed Jenkins API requests by cause.",
+				ConstLabels: constLabels,
+			}, []string{"cause"}),
+		},
+		ResyncPeriod: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "jenkins_resync_duration_seconds",
+			Help:        "Time taken to sync all ProwJobs against Jenkins builds.",
+			ConstLabels: constLabels,
+		}),
+		JenkinsQueueLength: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "jenkins_queue_length",
+			Help:        "Number of items in the Jenkins build queue.",
+			ConstLabels: constLabels,
+		}),
+	}
+	m.ClientMetrics.JenkinsQueueLength = m.JenkinsQueueLength
+
+	prometheus.MustRegister(m.ClientMetrics.OIDCRefreshes)
+	prometheus.MustRegister(m.ClientMetrics.RequestErrors)
+	prometheus.MustRegister(m.ResyncPeriod)
+	prometheus.MustRegister(m.JenkinsQueueLength)
+
+	return m
+}
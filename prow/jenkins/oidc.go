@@ -0,0 +1,162 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// discoveryTimeout bounds the OIDC discovery-document fetch in
+// discoverTokenURL. NewOIDCTokenSource runs at startup, so an unresponsive
+// issuer must not be able to hang the operator's boot indefinitely.
+const discoveryTimeout = 10 * time.Second
+
+var discoveryClient = &http.Client{Timeout: discoveryTimeout}
+
+// TokenSource supplies a bearer token for each Jenkins request. Client calls
+// Token() before every outgoing request instead of holding a fixed string,
+// so implementations are free to refresh in the background.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// staticTokenSource always returns the same token, used when auth is
+// configured from a plain token file rather than OIDC.
+type staticTokenSource string
+
+func (s staticTokenSource) Token() (string, error) { return string(s), nil }
+
+// StaticTokenSource wraps a fixed bearer token as a TokenSource.
+func StaticTokenSource(token string) TokenSource {
+	return staticTokenSource(token)
+}
+
+// TokenSourceFunc adapts a plain function, such as a secret.Agent accessor
+// closure, to the TokenSource interface.
+type TokenSourceFunc func() string
+
+// Token returns the current value of the wrapped function.
+func (f TokenSourceFunc) Token() (string, error) { return f(), nil }
+
+// OIDCConfig configures a client-credentials flow against an OIDC issuer
+// such as Keycloak or Dex. The refresh_token grant is not used.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	// TokenURL overrides the token endpoint used for the client-credentials
+	// exchange. When empty, NewOIDCTokenSource discovers it from
+	// IssuerURL + "/.well-known/openid-configuration", since providers
+	// disagree on the token endpoint's path (e.g. Keycloak's
+	// "/protocol/openid-connect/token" vs Dex's "/token").
+	TokenURL string
+}
+
+// oidcTokenSource caches the access token returned by the issuer and
+// refreshes it shortly before it expires so that long-running syncs never
+// see a 401 from an expired token.
+type oidcTokenSource struct {
+	source oauth2.TokenSource
+}
+
+// NewOIDCTokenSource builds a TokenSource that performs an OIDC
+// client-credentials exchange against cfg's token endpoint and transparently
+// refreshes the resulting access token before it expires. metrics.OIDCRefreshes
+// is incremented once per actual token fetch, not per Token() call.
+func NewOIDCTokenSource(cfg OIDCConfig, metrics *ClientMetrics) (TokenSource, error) {
+	tokenURL := cfg.TokenURL
+	if tokenURL == "" {
+		discovered, err := discoverTokenURL(cfg.IssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("discovering OIDC token endpoint: %v", err)
+		}
+		tokenURL = discovered
+	}
+	ccConfig := clientcredentials.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		TokenURL:     tokenURL,
+		Scopes:       cfg.Scopes,
+	}
+	fetcher := &meteredTokenFetcher{cfg: ccConfig, metrics: metrics}
+	return &oidcTokenSource{source: oauth2.ReuseTokenSource(nil, fetcher)}, nil
+}
+
+// discoverTokenURL fetches issuerURL's OIDC discovery document and returns
+// its token_endpoint.
+func discoverTokenURL(issuerURL string) (string, error) {
+	discoveryURL := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+	resp, err := discoveryClient.Get(discoveryURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, discoveryURL)
+	}
+	var doc struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", fmt.Errorf("error decoding %s: %v", discoveryURL, err)
+	}
+	if doc.TokenEndpoint == "" {
+		return "", fmt.Errorf("%s has no token_endpoint", discoveryURL)
+	}
+	return doc.TokenEndpoint, nil
+}
+
+// meteredTokenFetcher performs the actual client-credentials token request
+// and records it in metrics. It is only ever called by the
+// oauth2.ReuseTokenSource wrapping it, which only calls Token() when its
+// cached token is missing or near expiry, so metrics.OIDCRefreshes counts
+// real refreshes rather than every Jenkins request.
+type meteredTokenFetcher struct {
+	cfg     clientcredentials.Config
+	metrics *ClientMetrics
+}
+
+func (f *meteredTokenFetcher) Token() (*oauth2.Token, error) {
+	tok, err := f.cfg.Token(context.Background())
+	if f.metrics != nil {
+		if err != nil {
+			f.metrics.OIDCRefreshes.WithLabelValues("error").Inc()
+		} else {
+			f.metrics.OIDCRefreshes.WithLabelValues("success").Inc()
+		}
+	}
+	return tok, err
+}
+
+// Token returns a valid access token, fetching or refreshing it as needed.
+func (o *oidcTokenSource) Token() (string, error) {
+	tok, err := o.source.Token()
+	if err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkinsoperator
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Component names accepted by the repeatable --disable flag. Each names a
+// subsystem that Server would otherwise start unconditionally.
+const (
+	ComponentLogServing  = "log-serving"
+	ComponentMetrics     = "metrics"
+	ComponentPushGateway = "pushgateway"
+	ComponentGather      = "gather"
+	ComponentSCMReporter = "scm-reporter"
+)
+
+// components lists every name ValidateComponents accepts.
+var components = map[string]bool{
+	ComponentLogServing:  true,
+	ComponentMetrics:     true,
+	ComponentPushGateway: true,
+	ComponentGather:      true,
+	ComponentSCMReporter: true,
+}
+
+// ValidateComponents rejects any name that isn't a known component and
+// returns the accepted names as a set.
+func ValidateComponents(names []string) (map[string]bool, error) {
+	disabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !components[name] {
+			return nil, fmt.Errorf("unknown --disable component %q", name)
+		}
+		disabled[name] = true
+	}
+	return disabled, nil
+}
+
+// EnabledComponents returns the names of every known component not present
+// in disabled, sorted for stable logging.
+func EnabledComponents(disabled map[string]bool) []string {
+	enabled := make([]string, 0, len(components))
+	for name := range components {
+		if !disabled[name] {
+			enabled = append(enabled, name)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
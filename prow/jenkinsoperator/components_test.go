@@ -0,0 +1,94 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkinsoperator
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValidateComponents(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		wantErr  bool
+		wantKeys []string
+	}{
+		{
+			name:     "empty",
+			input:    nil,
+			wantKeys: nil,
+		},
+		{
+			name:     "known components",
+			input:    []string{ComponentMetrics, ComponentGather},
+			wantKeys: []string{ComponentGather, ComponentMetrics},
+		},
+		{
+			name:    "unknown component",
+			input:   []string{"bogus"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disabled, err := ValidateComponents(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateComponents(%v) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var keys []string
+			for k := range disabled {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("ValidateComponents(%v) disabled = %v, want %v", tt.input, keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestEnabledComponents(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled map[string]bool
+		want     []string
+	}{
+		{
+			name:     "nothing disabled",
+			disabled: map[string]bool{},
+			want:     []string{ComponentGather, ComponentLogServing, ComponentMetrics, ComponentPushGateway, ComponentSCMReporter},
+		},
+		{
+			name:     "scm reporter disabled",
+			disabled: map[string]bool{ComponentSCMReporter: true},
+			want:     []string{ComponentGather, ComponentLogServing, ComponentMetrics, ComponentPushGateway},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EnabledComponents(tt.disabled)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EnabledComponents(%v) = %v, want %v", tt.disabled, got, tt.want)
+			}
+		})
+	}
+}
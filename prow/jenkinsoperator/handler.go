@@ -0,0 +1,60 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkinsoperator
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/jenkins"
+)
+
+// handleLog proxies a ProwJob's Jenkins build log, so Deck can link here
+// instead of baking agent-specific log-fetching logic into itself. clients
+// is keyed by master name; a request may pick one with the "master" query
+// parameter, and falls back to defaultMaster when it's omitted.
+func handleLog(clients map[string]*jenkins.Client, defaultMaster string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("job")
+		buildID := r.URL.Query().Get("id")
+		if name == "" || buildID == "" {
+			http.Error(w, "request must include job and id query parameters", http.StatusBadRequest)
+			return
+		}
+
+		master := r.URL.Query().Get("master")
+		if master == "" {
+			master = defaultMaster
+		}
+		jc, ok := clients[master]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown master %q", master), http.StatusBadRequest)
+			return
+		}
+
+		log, err := jc.GetLog(name, buildID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error getting log: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(log); err != nil {
+			logrus.WithError(err).Warning("Error writing log response.")
+		}
+	}
+}
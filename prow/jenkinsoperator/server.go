@@ -0,0 +1,243 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jenkinsoperator holds the long-running pieces of the
+// jenkins-operator binary (the resync loop, the metrics gatherer, and the
+// log/metrics HTTP endpoint) behind a Server type that cmd/jenkins-operator
+// can construct and exercise in tests without a real Jenkins or Kubernetes
+// API server.
+package jenkinsoperator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/jenkins"
+	m "k8s.io/test-infra/prow/metrics"
+)
+
+const (
+	// DefaultResyncInterval is how often Server resyncs ProwJobs against
+	// Jenkins builds when ResyncInterval is left unset.
+	DefaultResyncInterval = 30 * time.Second
+	// DefaultGatherInterval is how often Server gathers Jenkins metrics
+	// when GatherInterval is left unset.
+	DefaultGatherInterval = 30 * time.Second
+)
+
+// MasterServer pairs one Jenkins master's Controller and Client with the
+// metrics that master's Sync/SyncMetrics loops report to. Server runs one
+// resync loop and one gather loop per MasterServer concurrently, so a slow
+// or unreachable master never blocks the others.
+type MasterServer struct {
+	// Name labels this master's log lines and, via Metrics, its
+	// Prometheus series. Must be unique within a Server's Masters.
+	Name          string
+	Controller    *jenkins.Controller
+	JenkinsClient *jenkins.Client
+	Metrics       *jenkins.Metrics
+}
+
+// Server owns the goroutines that used to live directly in main: serving
+// Jenkins logs and Prometheus metrics, gathering metrics from every Jenkins
+// controller, pushing them to a pushgateway, and periodically syncing
+// ProwJobs across every configured master. Run blocks until ctx is
+// cancelled, draining in-flight work before returning.
+type Server struct {
+	// Masters is the set of Jenkins masters this operator drives. A
+	// single-master deployment still populates one entry.
+	Masters []MasterServer
+	Logger  *logrus.Entry
+
+	// ResyncInterval and GatherInterval default to DefaultResyncInterval
+	// and DefaultGatherInterval respectively when zero.
+	ResyncInterval time.Duration
+	GatherInterval time.Duration
+
+	// ListenAddr is the address the log/metrics HTTP server listens on.
+	// Defaults to ":8080" when empty.
+	ListenAddr string
+
+	// PushGatewayEndpoint, when set, is pushed Prometheus metrics to
+	// every PushGatewayInterval.
+	PushGatewayEndpoint string
+	PushGatewayInterval time.Duration
+
+	// Disabled holds the component names (see Component* constants) that
+	// should not be started, as produced by ValidateComponents.
+	Disabled map[string]bool
+
+	httpServer *http.Server
+}
+
+func (s *Server) isDisabled(component string) bool {
+	return s.Disabled[component]
+}
+
+// Run starts the resync loop, the metrics gatherer, the optional
+// pushgateway pusher, and the log/metrics HTTP server, and blocks until ctx
+// is cancelled. On cancellation it stops accepting new work and shuts the
+// HTTP server down gracefully, waiting for in-flight requests and syncs to
+// finish.
+func (s *Server) Run(ctx context.Context) error {
+	resyncInterval := s.ResyncInterval
+	if resyncInterval == 0 {
+		resyncInterval = DefaultResyncInterval
+	}
+	gatherInterval := s.GatherInterval
+	if gatherInterval == 0 {
+		gatherInterval = DefaultGatherInterval
+	}
+	listenAddr := s.ListenAddr
+	if listenAddr == "" {
+		listenAddr = ":8080"
+	}
+
+	clients := make(map[string]*jenkins.Client, len(s.Masters))
+	for _, ms := range s.Masters {
+		clients[ms.Name] = ms.JenkinsClient
+	}
+
+	mux := http.NewServeMux()
+	if !s.isDisabled(ComponentLogServing) && len(s.Masters) > 0 {
+		mux.Handle("/", gziphandler.GzipHandler(handleLog(clients, s.Masters[0].Name)))
+	}
+	if !s.isDisabled(ComponentMetrics) {
+		mux.Handle("/metrics", promhttp.Handler())
+	}
+
+	// runCtx is cancelled either by the caller's ctx or, early, by a
+	// startup failure in the log/metrics server below, so that a bind
+	// failure stops the sync/gather loops instead of leaving them running
+	// with no observability until SIGTERM.
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+
+	serveErr := make(chan error, 1)
+	if !s.isDisabled(ComponentLogServing) || !s.isDisabled(ComponentMetrics) {
+		s.httpServer = &http.Server{Addr: listenAddr, Handler: mux}
+		go func() {
+			if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serveErr <- err
+				return
+			}
+			serveErr <- nil
+		}()
+	} else {
+		serveErr <- nil
+	}
+
+	if s.PushGatewayEndpoint != "" && !s.isDisabled(ComponentPushGateway) {
+		go m.PushMetrics("jenkins-operator", s.PushGatewayEndpoint, s.PushGatewayInterval)
+	}
+
+	if !s.isDisabled(ComponentGather) {
+		for _, ms := range s.Masters {
+			go s.gather(runCtx, ms, gatherInterval)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(s.Masters))
+	for _, ms := range s.Masters {
+		wg.Add(1)
+		go func(ms MasterServer) {
+			defer wg.Done()
+			errs <- s.syncLoop(runCtx, ms, resyncInterval)
+		}(ms)
+	}
+	go func() {
+		wg.Wait()
+		close(errs)
+	}()
+
+	var serveStartupErr error
+	select {
+	case serveStartupErr = <-serveErr:
+		if serveStartupErr != nil {
+			s.Logger.WithError(serveStartupErr).Error("Error serving logs and metrics, shutting down.")
+			cancelRun()
+		}
+	case <-ctx.Done():
+	}
+
+	for err := range errs {
+		if err != nil && serveStartupErr == nil {
+			serveStartupErr = err
+		}
+	}
+
+	if s.httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+			s.Logger.WithError(err).Error("Error shutting down HTTP server.")
+		}
+	}
+	if serveStartupErr != nil {
+		return fmt.Errorf("serving logs and metrics: %v", serveStartupErr)
+	}
+	return nil
+}
+
+// syncLoop periodically calls ms.Controller.Sync until ctx is cancelled.
+func (s *Server) syncLoop(ctx context.Context, ms MasterServer, interval time.Duration) error {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	logger := s.Logger.WithField("master", ms.Name)
+	for {
+		select {
+		case <-tick.C:
+			start := time.Now()
+			if err := ms.Controller.Sync(); err != nil {
+				logger.WithError(err).Error("Error syncing.")
+			}
+			duration := time.Since(start)
+			logger.WithField("duration", fmt.Sprintf("%v", duration)).Info("Synced")
+			ms.Metrics.ResyncPeriod.Observe(duration.Seconds())
+		case <-ctx.Done():
+			logger.Info("Jenkins operator is shutting down...")
+			return nil
+		}
+	}
+}
+
+// gather periodically calls ms.Controller.SyncMetrics until ctx is cancelled.
+func (s *Server) gather(ctx context.Context, ms MasterServer, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	logger := s.Logger.WithField("master", ms.Name)
+	for {
+		select {
+		case <-tick.C:
+			start := time.Now()
+			ms.Controller.SyncMetrics()
+			logger.WithField("metrics-duration", fmt.Sprintf("%v", time.Since(start))).Debug("Metrics synced")
+		case <-ctx.Done():
+			logger.Debug("Jenkins operator gatherer is shutting down...")
+			return
+		}
+	}
+}
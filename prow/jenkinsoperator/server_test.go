@@ -0,0 +1,107 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jenkinsoperator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestServerRunGracefulShutdown(t *testing.T) {
+	s := &Server{
+		Logger:         logrus.NewEntry(logrus.New()),
+		ResyncInterval: time.Hour,
+		GatherInterval: time.Hour,
+		ListenAddr:     "127.0.0.1:0",
+		Disabled:       map[string]bool{ComponentLogServing: true},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil after clean shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return within 5s of ctx cancellation")
+	}
+}
+
+func TestServerRunWithNoMastersSkipsLogServing(t *testing.T) {
+	s := &Server{
+		Logger:         logrus.NewEntry(logrus.New()),
+		ResyncInterval: time.Hour,
+		GatherInterval: time.Hour,
+		ListenAddr:     "127.0.0.1:0",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil with no masters configured", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return within 5s of ctx cancellation")
+	}
+}
+
+func TestServerRunFailsFastOnListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserving a port: %v", err)
+	}
+	defer listener.Close()
+
+	s := &Server{
+		Logger:         logrus.NewEntry(logrus.New()),
+		ResyncInterval: time.Hour,
+		GatherInterval: time.Hour,
+		ListenAddr:     listener.Addr().String(),
+		Disabled:       map[string]bool{ComponentLogServing: true},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Run() = nil, want an error from the already-bound listen address")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not fail fast on a startup listen error")
+	}
+}
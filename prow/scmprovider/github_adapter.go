@@ -0,0 +1,63 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scmprovider
+
+import "k8s.io/test-infra/prow/github"
+
+// githubProvider adapts the existing github.Client to the SCMProvider
+// interface so that github keeps being the zero-config default.
+type githubProvider struct {
+	client *github.Client
+}
+
+// NewGitHubProvider wraps an existing github.Client as an SCMProvider.
+func NewGitHubProvider(client *github.Client) SCMProvider {
+	return &githubProvider{client: client}
+}
+
+func (p *githubProvider) CreateStatus(org, repo, sha string, status github.Status) error {
+	return p.client.CreateStatus(org, repo, sha, status)
+}
+
+func (p *githubProvider) GetPullRequest(org, repo string, number int) (*PullRequest, error) {
+	pr, err := p.client.GetPullRequest(org, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequest{
+		Number:  pr.Number,
+		Author:  pr.User.Login,
+		HeadSHA: pr.Head.SHA,
+		BaseRef: pr.Base.Ref,
+	}, nil
+}
+
+func (p *githubProvider) ListPullRequestFiles(org, repo string, number int) ([]string, error) {
+	changes, err := p.client.GetPullRequestChanges(org, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(changes))
+	for _, change := range changes {
+		files = append(files, change.Filename)
+	}
+	return files, nil
+}
+
+func (p *githubProvider) CreateComment(org, repo string, number int, comment string) error {
+	return p.client.CreateComment(org, repo, number, comment)
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scmprovider
+
+import "k8s.io/test-infra/prow/github"
+
+// noopProvider is an SCMProvider that does nothing. It lets callers disable
+// status reporting without having to special-case a nil SCMProvider at every
+// call site.
+type noopProvider struct{}
+
+// NewNoopProvider returns an SCMProvider whose methods are all no-ops, for
+// use when status reporting is disabled.
+func NewNoopProvider() SCMProvider {
+	return noopProvider{}
+}
+
+func (noopProvider) CreateStatus(org, repo, sha string, status github.Status) error {
+	return nil
+}
+
+func (noopProvider) GetPullRequest(org, repo string, number int) (*PullRequest, error) {
+	return nil, nil
+}
+
+func (noopProvider) ListPullRequestFiles(org, repo string, number int) ([]string, error) {
+	return nil, nil
+}
+
+func (noopProvider) CreateComment(org, repo string, number int, comment string) error {
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scmprovider
+
+import (
+	"sync"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// RotatingProvider lets callers swap out the underlying SCMProvider at
+// runtime, e.g. to rebuild a client after its credential file is rotated on
+// disk, without the jenkins.Controller holding on to a stale client.
+type RotatingProvider struct {
+	mu      sync.RWMutex
+	current SCMProvider
+}
+
+// NewRotatingProvider wraps an initial SCMProvider for later rotation.
+func NewRotatingProvider(initial SCMProvider) *RotatingProvider {
+	return &RotatingProvider{current: initial}
+}
+
+// Swap atomically replaces the provider in use.
+func (r *RotatingProvider) Swap(next SCMProvider) {
+	r.mu.Lock()
+	r.current = next
+	r.mu.Unlock()
+}
+
+func (r *RotatingProvider) get() SCMProvider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+func (r *RotatingProvider) CreateStatus(org, repo, sha string, status github.Status) error {
+	return r.get().CreateStatus(org, repo, sha, status)
+}
+
+func (r *RotatingProvider) GetPullRequest(org, repo string, number int) (*PullRequest, error) {
+	return r.get().GetPullRequest(org, repo, number)
+}
+
+func (r *RotatingProvider) ListPullRequestFiles(org, repo string, number int) ([]string, error) {
+	return r.get().ListPullRequestFiles(org, repo, number)
+}
+
+func (r *RotatingProvider) CreateComment(org, repo string, number int, comment string) error {
+	return r.get().CreateComment(org, repo, number, comment)
+}
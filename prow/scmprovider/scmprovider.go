@@ -0,0 +1,48 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scmprovider defines the interface jenkins-operator (and other
+// agents that report status back to a forge) use to talk to whatever
+// source control management system is hosting the pull request, so that
+// callers don't need to hardcode against a single provider's client type.
+package scmprovider
+
+import "k8s.io/test-infra/prow/github"
+
+// PullRequest is the minimal view of a pull request that jenkins-operator
+// needs, independent of which SCM hosts it.
+type PullRequest struct {
+	Number  int
+	Author  string
+	HeadSHA string
+	BaseRef string
+}
+
+// SCMProvider is implemented by every forge client jenkins-operator can
+// report to. It is intentionally narrow: commit statuses, pull request
+// lookup, changed files and comments (jenkins.Controller itself only calls
+// CreateStatus), so that adding a new forge is a matter of implementing
+// these few methods rather than the whole of github.Client.
+type SCMProvider interface {
+	// CreateStatus sets or updates the commit status for sha in org/repo.
+	CreateStatus(org, repo, sha string, status github.Status) error
+	// GetPullRequest fetches the current state of a pull request.
+	GetPullRequest(org, repo string, number int) (*PullRequest, error)
+	// ListPullRequestFiles lists the paths changed by a pull request.
+	ListPullRequestFiles(org, repo string, number int) ([]string, error)
+	// CreateComment posts a comment on an issue or pull request.
+	CreateComment(org, repo string, number int, comment string) error
+}
@@ -0,0 +1,383 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package secret provides an Agent that watches secret files (tokens,
+// certificates) mounted from Kubernetes Secrets and keeps an in-memory,
+// always-current view of them, so that callers never have to restart the
+// process when a Secret is rotated. It follows the same watch-and-swap
+// shape as config.Agent.
+package secret
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var reloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "secret_agent_reloads_total",
+	Help: "Count of secret file reloads by path and result.",
+}, []string{"path", "result"})
+
+func init() {
+	prometheus.MustRegister(reloads)
+}
+
+// Agent watches a set of plain secret files and, optionally, one or more TLS
+// certificate/key/CA trios, keeping them up to date behind an RWMutex. Zero
+// value is not ready to use; call Start.
+type Agent struct {
+	mu          sync.RWMutex
+	secrets     map[string]string
+	certs       map[string]*certBundle
+	watchedDirs map[string]bool
+	watcher     *fsnotify.Watcher
+
+	logger *logrus.Entry
+
+	// OnReload, if set, is called with the path of each file that was
+	// just reloaded (a cert bundle's cert file stands in for its
+	// cert/key/ca trio). Useful for callers that need to rebuild
+	// something derived from a secret, e.g. an SCM client built from a
+	// rotated token.
+	OnReload func(path string)
+}
+
+// defaultCertBundle is the key under which Start's certFile/keyFile/caCertFile
+// arguments are stored, so GetTLSConfig keeps working unchanged for the
+// common single-master case.
+const defaultCertBundle = ""
+
+// certBundle is a TLS certificate/key/CA trio tracked under a name, so that
+// AddCertBundle can register additional, independently-rotating trios for
+// jenkins-operator's multi-master fan-out.
+type certBundle struct {
+	certFile, keyFile, caCertFile string
+	cert                          *tls.Certificate
+	caCertPool                    *x509.CertPool
+}
+
+// Start loads every path in secretPaths and, if certFile and keyFile are
+// non-empty, the TLS material, then begins watching all of them for
+// changes via fsnotify. It also reloads on SIGHUP, for environments where
+// the mounted-secret file watch doesn't fire (e.g. some overlay mounts).
+func (a *Agent) Start(secretPaths []string, certFile, keyFile, caCertFile string) error {
+	a.secrets = map[string]string{}
+	a.certs = map[string]*certBundle{}
+	a.watchedDirs = map[string]bool{}
+	a.logger = logrus.WithField("client", "secret-agent")
+
+	var err error
+	a.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range secretPaths {
+		if err := a.loadSecret(p); err != nil {
+			return err
+		}
+		if err := a.watchDirFor(p); err != nil {
+			return err
+		}
+	}
+	if certFile != "" && keyFile != "" {
+		if err := a.AddCertBundle(defaultCertBundle, certFile, keyFile, caCertFile); err != nil {
+			return err
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	go a.watch(a.watcher, sig)
+	return nil
+}
+
+// watchDirFor registers path's parent directory with the fsnotify watcher,
+// once per directory. Kubernetes rotates a mounted Secret by repointing a
+// ..data symlink, which removes and recreates the leaf files; a watch on the
+// file's own inode never sees the recreation, but a watch on its directory
+// does, since the directory entry itself is what changes.
+func (a *Agent) watchDirFor(path string) error {
+	dir := filepath.Dir(path)
+
+	a.mu.Lock()
+	already := a.watchedDirs[dir]
+	a.watchedDirs[dir] = true
+	a.mu.Unlock()
+
+	if already {
+		return nil
+	}
+	return a.watcher.Add(dir)
+}
+
+// isTracked reports whether path is a secret or cert-bundle file this Agent
+// cares about, so that directory-watch events for unrelated files (e.g.
+// Kubernetes' own ..data_tmp entries) don't trigger a reload.
+func (a *Agent) isTracked(path string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if _, ok := a.secrets[path]; ok {
+		return true
+	}
+	for _, b := range a.certs {
+		if path == b.certFile || path == b.keyFile || path == b.caCertFile {
+			return true
+		}
+	}
+	return false
+}
+
+// AddCertBundle registers an additional TLS certificate/key/CA trio under
+// name, loading it immediately and adding its files to the fsnotify watch.
+// jenkins-operator's multi-master fan-out calls this once per master that
+// defines its own TLS material; GetTLSConfigFor(name) then returns a config
+// that tracks that trio's rotations.
+func (a *Agent) AddCertBundle(name, certFile, keyFile, caCertFile string) error {
+	b := &certBundle{certFile: certFile, keyFile: keyFile, caCertFile: caCertFile}
+	if err := a.loadCertBundle(b); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.certs[name] = b
+	a.mu.Unlock()
+
+	for _, p := range []string{certFile, keyFile, caCertFile} {
+		if p == "" {
+			continue
+		}
+		if err := a.watchDirFor(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Agent) watch(watcher *fsnotify.Watcher, sig chan os.Signal) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if !a.isTracked(event.Name) {
+				continue
+			}
+			a.reload(event.Name)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			a.logger.WithError(err).Error("Error watching secret files.")
+		case <-sig:
+			a.logger.Info("Received SIGHUP, reloading all secrets.")
+			a.reloadAll()
+		}
+	}
+}
+
+func (a *Agent) reload(path string) {
+	var err error
+	reportedPath := path
+	if b := a.bundleForPath(path); b != nil {
+		err = a.loadCertBundle(b)
+		reportedPath = b.certFile
+	} else {
+		err = a.loadSecret(path)
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+		a.logger.WithError(err).WithField("path", path).Error("Error reloading secret.")
+	}
+	reloads.WithLabelValues(path, result).Inc()
+
+	if err == nil && a.OnReload != nil {
+		a.OnReload(reportedPath)
+	}
+}
+
+// bundleForPath returns the cert bundle that path belongs to, if any.
+func (a *Agent) bundleForPath(path string) *certBundle {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, b := range a.certs {
+		if path == b.certFile || path == b.keyFile || path == b.caCertFile {
+			return b
+		}
+	}
+	return nil
+}
+
+func (a *Agent) reloadAll() {
+	a.mu.RLock()
+	paths := make([]string, 0, len(a.secrets))
+	for p := range a.secrets {
+		paths = append(paths, p)
+	}
+	bundles := make([]*certBundle, 0, len(a.certs))
+	for _, b := range a.certs {
+		bundles = append(bundles, b)
+	}
+	a.mu.RUnlock()
+
+	for _, p := range paths {
+		a.reload(p)
+	}
+	for _, b := range bundles {
+		a.reload(b.certFile)
+	}
+}
+
+func (a *Agent) loadSecret(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	value := string(bytes.TrimSpace(raw))
+
+	a.mu.Lock()
+	a.secrets[path] = value
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *Agent) loadCertBundle(b *certBundle) error {
+	cert, err := tls.LoadX509KeyPair(b.certFile, b.keyFile)
+	if err != nil {
+		return err
+	}
+	var caCertPool *x509.CertPool
+	if b.caCertFile != "" {
+		caCert, err := ioutil.ReadFile(b.caCertFile)
+		if err != nil {
+			return err
+		}
+		caCertPool = x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(caCert)
+	}
+
+	a.mu.Lock()
+	b.cert = &cert
+	b.caCertPool = caCertPool
+	a.mu.Unlock()
+	return nil
+}
+
+// GetSecret returns an accessor closure for the current value of path.
+// Callers are expected to hold on to the closure rather than the string,
+// so that later rotations are visible without re-reading from the Agent.
+func (a *Agent) GetSecret(path string) func() string {
+	return func() string {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		return a.secrets[path]
+	}
+}
+
+// GetTLSConfig returns a *tls.Config for the default cert bundle (the one
+// passed to Start), whose client certificate and CA pool are always the
+// most recently loaded ones. The returned value can be handed to
+// jenkins.NewClient once at startup: its GetClientCertificate hook is
+// consulted by crypto/tls on every handshake, so a cert rotation takes
+// effect on the next connection without rebuilding the transport.
+func (a *Agent) GetTLSConfig() *tls.Config {
+	return a.GetTLSConfigFor(defaultCertBundle)
+}
+
+// GetTLSConfigFor returns a *tls.Config tracking the cert bundle registered
+// under name via AddCertBundle, for jenkins-operator's per-master TLS
+// material. If name was never registered, it returns a config with no
+// client certificate or CA pool, matching the behavior callers have always
+// seen from an Agent started without TLS material. Callers that know the
+// server's hostname up front (e.g. from the Jenkins master URL) should set
+// ServerName on the returned config themselves; http.Transport also fills
+// it in per-connection from the dial address if left empty.
+//
+// Unlike a plain RootCAs field, which would freeze the CA pool at the
+// moment this method is called, VerifyConnection re-reads the current pool
+// on every handshake, so a CA rotation takes effect on the very next
+// connection without rebuilding the transport.
+func (a *Agent) GetTLSConfigFor(name string) *tls.Config {
+	a.mu.RLock()
+	b, ok := a.certs[name]
+	a.mu.RUnlock()
+	if !ok {
+		b = &certBundle{}
+	}
+
+	return &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			a.mu.RLock()
+			defer a.mu.RUnlock()
+			return b.cert, nil
+		},
+		InsecureSkipVerify: true,
+		VerifyConnection:   a.verifyConnection(name),
+	}
+}
+
+// verifyConnection builds a VerifyConnection callback that validates the
+// server's certificate chain, including its hostname, against name's
+// current CA pool. Go's own chain verification is disabled
+// (InsecureSkipVerify) solely so that this callback, rather than a RootCAs
+// value fixed at config-build time, is what decides trust on every
+// handshake; unlike VerifyPeerCertificate, VerifyConnection's
+// ConnectionState carries ServerName, so hostname checking isn't lost
+// along with the built-in verification.
+func (a *Agent) verifyConnection(name string) func(cs tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("no certificate presented by server")
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         a.currentCAPool(name),
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
+
+func (a *Agent) currentCAPool(name string) *x509.CertPool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if b, ok := a.certs[name]; ok {
+		return b.caCertPool
+	}
+	return nil
+}